@@ -0,0 +1,148 @@
+// Package auth implements scoped API keys for the web layer: which
+// endpoints a key may call, which target URLs a submitted job may point
+// at, and a per-key token-bucket rate limit.
+package auth
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoint scopes a key can be granted.
+const (
+	EndpointSubmit = "submit"
+	EndpointStatus = "status"
+	EndpointAdmin  = "admin"
+)
+
+// RateLimitConfig is the token-bucket limit applied to a key's submissions.
+type RateLimitConfig struct {
+	JobsPerSecond float64 `json:"jobsPerSecond"`
+	Burst         int     `json:"burst"`
+}
+
+// KeyConfig is the on-disk representation of a single API key.
+type KeyConfig struct {
+	Name        string           `json:"name"`
+	Secret      string           `json:"secret"`
+	Endpoints   []string         `json:"endpoints"`
+	URLPrefixes []string         `json:"urlPrefixes"`
+	RateLimit   *RateLimitConfig `json:"rateLimit"`
+}
+
+// Key is a resolved, ready-to-use API key.
+type Key struct {
+	Name        string
+	endpoints   map[string]bool
+	urlPrefixes []string
+	limiter     *tokenBucket
+}
+
+// AllowsEndpoint reports whether this key is scoped for endpoint.
+func (k *Key) AllowsEndpoint(endpoint string) bool {
+	return k.endpoints[endpoint]
+}
+
+// AllowsURL reports whether this key may submit a job targeting url. A key
+// with no configured prefixes may target any URL.
+func (k *Key) AllowsURL(url string) bool {
+	if len(k.urlPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range k.urlPrefixes {
+		if strings.HasPrefix(url, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allow consumes one token from the key's rate limit, if one is
+// configured. Keys without a rate limit are always allowed.
+func (k *Key) Allow() bool {
+	if k.limiter == nil {
+		return true
+	}
+	return k.limiter.Allow()
+}
+
+// Registry resolves bearer secrets to the Key that owns them.
+type Registry struct {
+	keys map[string]*Key
+}
+
+// NewRegistry builds a Registry from configuration. A nil or empty configs
+// slice yields a Registry with Enabled() == false, so deployments that
+// don't configure keys keep working unauthenticated.
+func NewRegistry(configs []KeyConfig) *Registry {
+	r := &Registry{keys: make(map[string]*Key, len(configs))}
+	for _, cfg := range configs {
+		k := &Key{
+			Name:        cfg.Name,
+			endpoints:   make(map[string]bool, len(cfg.Endpoints)),
+			urlPrefixes: cfg.URLPrefixes,
+		}
+		for _, e := range cfg.Endpoints {
+			k.endpoints[e] = true
+		}
+		if cfg.RateLimit != nil {
+			k.limiter = newTokenBucket(cfg.RateLimit.JobsPerSecond, cfg.RateLimit.Burst)
+		}
+		r.keys[cfg.Secret] = k
+	}
+	return r
+}
+
+// Enabled reports whether any keys are configured.
+func (r *Registry) Enabled() bool {
+	return r != nil && len(r.keys) > 0
+}
+
+// Resolve looks up the Key owning secret.
+func (r *Registry) Resolve(secret string) (*Key, bool) {
+	if r == nil || secret == "" {
+		return nil, false
+	}
+	k, ok := r.keys[secret]
+	return k, ok
+}
+
+// tokenBucket is a minimal token-bucket rate limiter.
+type tokenBucket struct {
+	mu         sync.Mutex
+	capacity   float64
+	tokens     float64
+	refillRate float64
+	last       time.Time
+}
+
+func newTokenBucket(jobsPerSecond float64, burst int) *tokenBucket {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &tokenBucket{
+		capacity:   float64(burst),
+		tokens:     float64(burst),
+		refillRate: jobsPerSecond,
+		last:       time.Now(),
+	}
+}
+
+func (b *tokenBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.refillRate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/qiangxue/fasthttp-routing"
+	"github.com/xtrafrancyz/bwp/auth"
+)
+
+const apiKeyContextKey = "bwp.apiKey"
+
+// withPoolHeaders advertises pool state on every response so clients can
+// implement client-side backpressure without polling /status.
+func (ws *WebServer) withPoolHeaders(c *routing.Context) error {
+	c.Response.Header.Set("X-BWP-Queue-Limit", strconv.Itoa(ws.pool.QueueSize))
+	c.Response.Header.Set("X-BWP-Jobs-In-Queue", strconv.Itoa(ws.pool.GetQueueLength()))
+	c.Response.Header.Set("X-BWP-Active-Workers", strconv.Itoa(ws.pool.GetActiveWorkers()))
+	return c.Next()
+}
+
+// authenticate resolves the caller's API key and enforces its endpoint
+// scope. It is a no-op, for backwards compatibility, when no keys are
+// configured at all. The key's rate limit is charged per submitted job
+// by submitHttpJob, not here, since a single request can carry many jobs.
+func (ws *WebServer) authenticate(c *routing.Context) error {
+	if !ws.keys.Enabled() {
+		return c.Next()
+	}
+
+	secret := bearerToken(c)
+	if secret == "" {
+		secret = string(c.QueryArgs().Peek("k"))
+	}
+	key, ok := ws.keys.Resolve(secret)
+	if !ok {
+		return nilError(c, 401, "invalid or missing api key")
+	}
+	if !key.AllowsEndpoint(endpointForPath(string(c.Path()))) {
+		return nilError(c, 403, "api key is not scoped for this endpoint")
+	}
+
+	c.Set(apiKeyContextKey, key)
+	return c.Next()
+}
+
+func bearerToken(c *routing.Context) string {
+	const prefix = "Bearer "
+	header := string(c.Request.Header.Peek("Authorization"))
+	if strings.HasPrefix(header, prefix) {
+		return header[len(prefix):]
+	}
+	return ""
+}
+
+// endpointForPath maps a request path to the auth scope that guards it.
+// Anything not explicitly recognized is treated as admin, so a key must be
+// granted that scope before it can reach a future or unlisted route.
+func endpointForPath(path string) string {
+	switch {
+	case path == "/post/http":
+		return auth.EndpointSubmit
+	case path == "/status" || strings.HasPrefix(path, "/jobs"):
+		return auth.EndpointStatus
+	default:
+		return auth.EndpointAdmin
+	}
+}
+
+// keyFromContext returns the API key resolved for this request by
+// authenticate, or nil if key auth isn't enabled.
+func keyFromContext(c *routing.Context) *auth.Key {
+	key, _ := c.Get(apiKeyContextKey).(*auth.Key)
+	return key
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/json-iterator/go"
+	"github.com/qiangxue/fasthttp-routing"
+	"github.com/ulikunitz/xz"
+)
+
+var ndjsonContentType = []byte("application/x-ndjson")
+
+// decodeRequestBody wraps the request body in the decoder matching its
+// Content-Encoding header, mirroring the dispatcher pattern used by
+// encode-server-style handlers. With no Content-Encoding set, the body is
+// returned unmodified.
+func decodeRequestBody(c *routing.Context) (io.Reader, error) {
+	var body io.Reader
+	if stream := c.RequestBodyStream(); stream != nil {
+		body = stream
+	} else {
+		body = bytes.NewReader(c.PostBody())
+	}
+
+	encoding := c.Request.Header.Peek("Content-Encoding")
+	switch string(encoding) {
+	case "":
+		return body, nil
+	case "gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		return flate.NewReader(body), nil
+	case "xz":
+		return xz.NewReader(body)
+	default:
+		return nil, fmt.Errorf("unsupported content-encoding %q", encoding)
+	}
+}
+
+// ndjsonRow is one line of the streaming response to a batched NDJSON
+// submission, reporting the fate of a single job.
+type ndjsonRow struct {
+	ID       string `json:"id,omitempty"`
+	Accepted bool   `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// handleNdjsonBatch stream-parses one job object per line from reader and
+// pushes each into the pool as soon as it is decoded, keeping memory usage
+// bounded regardless of batch size. It streams back one ndjsonRow per
+// input job so the caller learns which jobs were queued versus rejected.
+func (ws *WebServer) handleNdjsonBatch(c *routing.Context, reader io.Reader) error {
+	key := keyFromContext(c)
+
+	c.SetStatusCode(200)
+	c.SetContentType("application/x-ndjson")
+	c.SetBodyStreamWriter(func(w *bufio.Writer) {
+		iter := jsoniter.Parse(jsoniter.ConfigCompatibleWithStandardLibrary, reader, 4096)
+		for iter.WhatIsNext() != jsoniter.InvalidValue {
+			row := ndjsonRow{}
+			jobData, err := unmarshalHttpJobData(iter, key)
+			if err != nil {
+				row.Error = err.Error()
+			} else if err := ws.submitHttpJob(jobData, key); err != nil {
+				row.Error = err.Error()
+			} else {
+				row.ID = jobData.ID
+				row.Accepted = true
+			}
+
+			line, _ := json.Marshal(row)
+			if _, err := w.Write(line); err != nil {
+				return
+			}
+			_ = w.WriteByte('\n')
+			if err := w.Flush(); err != nil {
+				return
+			}
+
+			if iter.Error != nil && iter.Error != io.EOF {
+				return
+			}
+		}
+	})
+	return nil
+}
@@ -0,0 +1,21 @@
+package job
+
+// CallbackConfig describes an optional webhook to notify once a job has
+// reached a terminal state.
+type CallbackConfig struct {
+	Url           string            `json:"url"`
+	Headers       map[string]string `json:"headers"`
+	OnlyOnFailure bool              `json:"onlyOnFailure"`
+	IncludeBody   bool              `json:"includeBody"`
+}
+
+// CallbackPayload is the JSON document POSTed to a job's callback URL.
+type CallbackPayload struct {
+	JobID           string            `json:"jobId"`
+	State           State             `json:"state"`
+	Attempts        int               `json:"attempts"`
+	DurationMs      int64             `json:"durationMs"`
+	StatusCode      int               `json:"statusCode,omitempty"`
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty"`
+	ResponseBodyB64 string            `json:"responseBodyBase64,omitempty"`
+}
@@ -0,0 +1,17 @@
+package job
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// NewID returns a lexically sortable, practically-unique job identifier: a
+// millisecond timestamp followed by random bytes, similar in spirit to a
+// ULID but without pulling in an extra dependency.
+func NewID() string {
+	var suffix [10]byte
+	_, _ = rand.Read(suffix[:])
+	return fmt.Sprintf("%013x%s", time.Now().UnixMilli(), hex.EncodeToString(suffix[:]))
+}
@@ -0,0 +1,61 @@
+package job
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// HttpData describes a single outbound HTTP request to be executed by a
+// worker. Instances are pooled via AcquireHttpData/ReleaseHttpData to keep
+// the hot path free of allocations.
+type HttpData struct {
+	ID         string
+	Url        string
+	Method     string
+	RawBody    []byte
+	Parameters map[string]string
+	Headers    map[string]string
+	Retry      RetryPolicy
+	Callback   *CallbackConfig
+	TimeoutMs  int
+	Deadline   time.Time
+}
+
+// Context derives a context bound to this job's deadline, if any, from
+// base (typically the owning pool's lifetime context). An explicit
+// Deadline takes priority over TimeoutMs. If neither is set, the returned
+// context is only ever cancelled by base itself.
+func (d *HttpData) Context(base context.Context) (context.Context, context.CancelFunc) {
+	if !d.Deadline.IsZero() {
+		return context.WithDeadline(base, d.Deadline)
+	}
+	if d.TimeoutMs > 0 {
+		return context.WithTimeout(base, time.Duration(d.TimeoutMs)*time.Millisecond)
+	}
+	return context.WithCancel(base)
+}
+
+var httpDataPool = sync.Pool{
+	New: func() interface{} {
+		return &HttpData{}
+	},
+}
+
+func AcquireHttpData() *HttpData {
+	return httpDataPool.Get().(*HttpData)
+}
+
+func ReleaseHttpData(d *HttpData) {
+	d.ID = ""
+	d.Url = ""
+	d.Method = ""
+	d.RawBody = nil
+	d.Parameters = nil
+	d.Headers = nil
+	d.Retry = RetryPolicy{}
+	d.Callback = nil
+	d.TimeoutMs = 0
+	d.Deadline = time.Time{}
+	httpDataPool.Put(d)
+}
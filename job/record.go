@@ -0,0 +1,222 @@
+package job
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// State is the lifecycle stage of a submitted job.
+type State string
+
+const (
+	StateQueued  State = "queued"
+	StateRunning State = "running"
+	StateDone    State = "done"
+	StateFailed  State = "failed"
+	StateTimeout State = "timeout"
+)
+
+// Record tracks the lifecycle of a single submitted job so that callers can
+// poll for its outcome instead of only learning whether it was accepted.
+type Record struct {
+	mu sync.Mutex
+
+	ID              string
+	State           State
+	SubmittedAt     time.Time
+	StartedAt       time.Time
+	FinishedAt      time.Time
+	Attempts        int
+	LastStatusCode  int
+	LastError       string
+	ResponseSnippet string
+}
+
+// Snapshot is a point-in-time, JSON-friendly copy of a Record.
+type Snapshot struct {
+	ID              string    `json:"id"`
+	State           State     `json:"state"`
+	SubmittedAt     time.Time `json:"submittedAt"`
+	StartedAt       time.Time `json:"startedAt,omitempty"`
+	FinishedAt      time.Time `json:"finishedAt,omitempty"`
+	Attempts        int       `json:"attempts"`
+	LastStatusCode  int       `json:"lastStatusCode,omitempty"`
+	LastError       string    `json:"lastError,omitempty"`
+	ResponseSnippet string    `json:"responseSnippet,omitempty"`
+}
+
+func (r *Record) snapshot() Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return Snapshot{
+		ID:              r.ID,
+		State:           r.State,
+		SubmittedAt:     r.SubmittedAt,
+		StartedAt:       r.StartedAt,
+		FinishedAt:      r.FinishedAt,
+		Attempts:        r.Attempts,
+		LastStatusCode:  r.LastStatusCode,
+		LastError:       r.LastError,
+		ResponseSnippet: r.ResponseSnippet,
+	}
+}
+
+// MarkRunning records the start of an attempt.
+func (r *Record) MarkRunning() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.State = StateRunning
+	if r.StartedAt.IsZero() {
+		r.StartedAt = time.Now()
+	}
+	r.Attempts++
+}
+
+// MarkDone records a terminal, successful outcome.
+func (r *Record) MarkDone(statusCode int, responseSnippet string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.State = StateDone
+	r.FinishedAt = time.Now()
+	r.LastStatusCode = statusCode
+	r.ResponseSnippet = responseSnippet
+}
+
+// MarkFailed records a terminal failure. statusCode and responseSnippet
+// carry the last response actually received, if any (e.g. retries
+// exhausted on a status the caller configured as a failure); callers
+// without one pass 0 and "".
+func (r *Record) MarkFailed(statusCode int, responseSnippet string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.State = StateFailed
+	r.FinishedAt = time.Now()
+	r.LastStatusCode = statusCode
+	r.ResponseSnippet = responseSnippet
+	if err != nil {
+		r.LastError = err.Error()
+	}
+}
+
+// MarkTimeout records a terminal failure caused by the job's deadline
+// elapsing, kept distinct from MarkFailed so callers can tell the two
+// apart. statusCode and responseSnippet carry the last response actually
+// received, if any; callers without one pass 0 and "".
+func (r *Record) MarkTimeout(statusCode int, responseSnippet string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.State = StateTimeout
+	r.FinishedAt = time.Now()
+	r.LastStatusCode = statusCode
+	r.ResponseSnippet = responseSnippet
+	if err != nil {
+		r.LastError = err.Error()
+	}
+}
+
+// StoreConfig controls how many records Store keeps and for how long.
+type StoreConfig struct {
+	MaxEntries int
+	Retention  time.Duration
+}
+
+// DefaultStoreConfig is used when no explicit configuration is supplied.
+var DefaultStoreConfig = StoreConfig{
+	MaxEntries: 10000,
+	Retention:  1 * time.Hour,
+}
+
+// Store is an in-memory, ring-buffer-backed table of Records keyed by job
+// ID. Oldest entries are evicted once MaxEntries is exceeded or once they
+// are older than Retention. Eviction runs only inside Put, so Get and List
+// can still return a record older than Retention until the next Put.
+type Store struct {
+	cfg StoreConfig
+
+	mu    sync.Mutex
+	order *list.List // of *Record, oldest at Front
+	byID  map[string]*list.Element
+}
+
+func NewStore(cfg StoreConfig) *Store {
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = DefaultStoreConfig.MaxEntries
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = DefaultStoreConfig.Retention
+	}
+	return &Store{
+		cfg:   cfg,
+		order: list.New(),
+		byID:  make(map[string]*list.Element),
+	}
+}
+
+// Put registers a new Record, evicting old entries as needed.
+func (s *Store) Put(r *Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evictLocked()
+	s.byID[r.ID] = s.order.PushBack(r)
+}
+
+// Get returns a snapshot of the record with the given ID.
+func (s *Store) Get(id string) (Snapshot, bool) {
+	rec, ok := s.GetLive(id)
+	if !ok {
+		return Snapshot{}, false
+	}
+	return rec.snapshot(), true
+}
+
+// GetLive returns the mutable Record with the given ID, for use by the
+// worker that owns its lifecycle. Everything outside the job/worker
+// packages should prefer Get, which returns an immutable Snapshot.
+func (s *Store) GetLive(id string) (*Record, bool) {
+	s.mu.Lock()
+	el, ok := s.byID[id]
+	s.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return el.Value.(*Record), true
+}
+
+// List returns snapshots of at most limit records, newest first, optionally
+// filtered by state. A limit <= 0 means no limit.
+func (s *Store) List(state State, limit int) []Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Snapshot, 0, s.order.Len())
+	for e := s.order.Back(); e != nil; e = e.Prev() {
+		rec := e.Value.(*Record)
+		snap := rec.snapshot()
+		if state != "" && snap.State != state {
+			continue
+		}
+		out = append(out, snap)
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+	}
+	return out
+}
+
+func (s *Store) evictLocked() {
+	cutoff := time.Now().Add(-s.cfg.Retention)
+	for s.order.Len() > 0 {
+		front := s.order.Front()
+		rec := front.Value.(*Record)
+		rec.mu.Lock()
+		expired := rec.SubmittedAt.Before(cutoff)
+		id := rec.ID
+		rec.mu.Unlock()
+		overflowing := s.order.Len() >= s.cfg.MaxEntries
+		if !expired && !overflowing {
+			break
+		}
+		s.order.Remove(front)
+		delete(s.byID, id)
+	}
+}
@@ -0,0 +1,98 @@
+package job
+
+import "time"
+
+// RetryPolicy controls how a failed HTTP job is retried.
+type RetryPolicy struct {
+	MaxAttempts         int     `json:"maxAttempts"`
+	InitialDelayMs      int     `json:"initialDelayMs"`
+	MaxDelayMs          int     `json:"maxDelayMs"`
+	Multiplier          float64 `json:"multiplier"`
+	Jitter              float64 `json:"jitter"`
+	RetryOn             []int   `json:"retryOn"`
+	RetryOnNetworkError bool    `json:"retryOnNetworkError"`
+
+	// JitterSet records whether the caller explicitly provided "jitter",
+	// since 0 is both the zero value and a legitimate "disable jitter"
+	// setting and so can't be distinguished from "unset" on its own.
+	JitterSet bool `json:"-"`
+}
+
+// DefaultRetryPolicy is used for jobs that don't specify their own retry
+// block, and to fill in any fields the caller left unset.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:         1,
+	InitialDelayMs:      200,
+	MaxDelayMs:          30000,
+	Multiplier:          2.0,
+	Jitter:              0.2,
+	RetryOn:             nil,
+	RetryOnNetworkError: false,
+}
+
+// WithDefaults returns a copy of p with zero-value fields replaced by
+// DefaultRetryPolicy's values.
+func (p RetryPolicy) WithDefaults() RetryPolicy {
+	d := DefaultRetryPolicy
+	if p.MaxAttempts > 0 {
+		d.MaxAttempts = p.MaxAttempts
+	}
+	if p.InitialDelayMs > 0 {
+		d.InitialDelayMs = p.InitialDelayMs
+	}
+	if p.MaxDelayMs > 0 {
+		d.MaxDelayMs = p.MaxDelayMs
+	}
+	if p.Multiplier > 0 {
+		d.Multiplier = p.Multiplier
+	}
+	if p.JitterSet {
+		d.Jitter = p.Jitter
+		d.JitterSet = true
+	}
+	if p.RetryOn != nil {
+		d.RetryOn = p.RetryOn
+	}
+	d.RetryOnNetworkError = p.RetryOnNetworkError
+	return d
+}
+
+// ShouldRetry reports whether a job that came back with statusCode (or a
+// non-nil networkErr) is eligible for another attempt, per this policy.
+func (p RetryPolicy) ShouldRetry(statusCode int, networkErr error) bool {
+	if networkErr != nil {
+		return p.RetryOnNetworkError
+	}
+	for _, code := range p.RetryOn {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// Delay returns the backoff duration to wait after attempt number
+// `attempt` (1-based) has failed, before the next one: InitialDelayMs *
+// Multiplier^(attempt-1), capped at MaxDelayMs, then scaled by jitter.
+// Jitter is applied after the cap, so the result can exceed MaxDelayMs by
+// up to the Jitter fraction.
+func (p RetryPolicy) Delay(attempt int, jitter func() float64) time.Duration {
+	max := float64(p.MaxDelayMs)
+	base := float64(p.InitialDelayMs)
+	for i := 1; i < attempt; i++ {
+		base *= p.Multiplier
+		if base > max {
+			base = max
+			break
+		}
+	}
+	if p.Jitter > 0 {
+		// jitter() returns a value in [-1, 1]; scale it by the configured
+		// fraction of the base delay.
+		base += base * p.Jitter * jitter()
+		if base < 0 {
+			base = 0
+		}
+	}
+	return time.Duration(base) * time.Millisecond
+}
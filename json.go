@@ -0,0 +1,5 @@
+package main
+
+import "github.com/json-iterator/go"
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
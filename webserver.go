@@ -3,12 +3,15 @@ package main
 import (
 	"bytes"
 	"container/list"
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
@@ -16,24 +19,39 @@ import (
 	"github.com/json-iterator/go"
 	"github.com/qiangxue/fasthttp-routing"
 	"github.com/valyala/fasthttp"
+	"github.com/xtrafrancyz/bwp/auth"
 	"github.com/xtrafrancyz/bwp/job"
 	"github.com/xtrafrancyz/bwp/worker"
 )
 
 type WebServer struct {
 	pool      *worker.Pool
+	keys      *auth.Registry
 	server    *fasthttp.Server
 	listeners *list.List
 }
 
 type jobResponse struct {
-	Success bool `json:"success"`
+	Success bool     `json:"success"`
+	Jobs    []string `json:"jobs"`
 }
 
-var (
-	jobResponseSuccess = jobResponse{true}
-	postStr            = []byte("POST")
-)
+type jobsListResponse struct {
+	Success bool           `json:"success"`
+	Jobs    []job.Snapshot `json:"jobs"`
+}
+
+var postStr = []byte("POST")
+
+// ErrRateLimited is returned by submitHttpJob when the submitting key's
+// per-job rate limit is exhausted.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// ErrURLNotAllowed is wrapped by unmarshalHttpJobData when a job's url or
+// callback.url falls outside the submitting key's urlPrefixes. It's an
+// authorization decision, not malformed input, so callers report it as
+// 403 rather than 400.
+var ErrURLNotAllowed = errors.New("url not allowed")
 
 type statusResponse struct {
 	QueueLimit    int `json:"queueLimit"`
@@ -42,20 +60,25 @@ type statusResponse struct {
 	JobsInQueue   int `json:"jobsInQueue"`
 }
 
-func NewWebServer(pool *worker.Pool) *WebServer {
+func NewWebServer(pool *worker.Pool, keys *auth.Registry) *WebServer {
 	ws := &WebServer{
 		pool:      pool,
+		keys:      keys,
 		listeners: list.New(),
 	}
 
 	router := routing.New()
+	router.Use(ws.withPoolHeaders, ws.authenticate)
 	router.Post("/post/http", ws.handlePostHttp)
 	router.Get("/status", ws.handleStatus)
+	router.Get("/jobs", ws.handleListJobs)
+	router.Get("/jobs/<id>", ws.handleGetJob)
 
 	ws.server = &fasthttp.Server{
 		Name:              "bwp",
 		Handler:           router.HandleRequest,
 		ReduceMemoryUsage: true,
+		StreamRequestBody: true,
 		WriteTimeout:      10 * time.Second,
 		ReadTimeout:       10 * time.Second,
 	}
@@ -86,10 +109,19 @@ func (ws *WebServer) Listen(gnet *gracenet.Net, host string) error {
 	return ws.server.Serve(ln)
 }
 
+// shutdownGrace bounds how long Finish waits for in-flight jobs to
+// complete before force-cancelling them.
+const shutdownGrace = 30 * time.Second
+
 func (ws *WebServer) Finish() {
 	for e := ws.listeners.Front(); e != nil; e = e.Next() {
 		_ = e.Value.(net.Listener).Close()
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+	defer cancel()
+	if err := ws.pool.Shutdown(ctx); err != nil {
+		log.Printf("job pool shutdown did not drain cleanly: %s", err)
+	}
 }
 
 func (ws *WebServer) handleStatus(c *routing.Context) error {
@@ -107,8 +139,20 @@ func (ws *WebServer) handleStatus(c *routing.Context) error {
 
 func (ws *WebServer) handlePostHttp(c *routing.Context) error {
 	if bytes.Equal(c.Method(), postStr) {
-		body := c.PostBody()
-		if body == nil || len(body) < 2 {
+		reader, err := decodeRequestBody(c)
+		if err != nil {
+			return nilError(c, 400, err.Error())
+		}
+
+		if bytes.Equal(c.Request.Header.ContentType(), ndjsonContentType) {
+			return ws.handleNdjsonBatch(c, reader)
+		}
+
+		body, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return nilError(c, 400, "failed to read request body: "+err.Error())
+		}
+		if len(body) < 2 {
 			return nilError(c, 400, "Invalid post body")
 		}
 		fc := body[0]
@@ -116,36 +160,40 @@ func (ws *WebServer) handlePostHttp(c *routing.Context) error {
 			return nilError(c, 400, "Invalid json data")
 		}
 
+		key := keyFromContext(c)
+
+		var ids []string
 		iter := json.BorrowIterator(body)
 		defer json.ReturnIterator(iter)
 		if fc == '[' {
 			jobs := acquireList()
 			for iter.ReadArray() {
-				jobData, err := unmarshalHttpJobData(iter)
+				jobData, err := unmarshalHttpJobData(iter, key)
 				if err != nil {
-					return nilError(c, 400, err.Error())
+					return nilError(c, unmarshalErrorStatus(err), err.Error())
 				}
 				jobs.PushBack(jobData)
 			}
 			for e := jobs.Front(); e != nil; e = e.Next() {
-				err := ws.pool.AddJob("http", e.Value.(*job.HttpData))
-				if err != nil {
-					return nilError(c, 503, err.Error())
+				jobData := e.Value.(*job.HttpData)
+				if err := ws.submitHttpJob(jobData, key); err != nil {
+					return nilError(c, submitErrorStatus(err), err.Error())
 				}
+				ids = append(ids, jobData.ID)
 			}
 			releaseList(jobs)
 		} else {
-			jobData, err := unmarshalHttpJobData(iter)
+			jobData, err := unmarshalHttpJobData(iter, key)
 			if err != nil {
-				return nilError(c, 400, err.Error())
+				return nilError(c, unmarshalErrorStatus(err), err.Error())
 			}
-			err = ws.pool.AddJob("http", jobData)
-			if err != nil {
-				return nilError(c, 503, err.Error())
+			if err := ws.submitHttpJob(jobData, key); err != nil {
+				return nilError(c, submitErrorStatus(err), err.Error())
 			}
+			ids = []string{jobData.ID}
 		}
 
-		response, _ := json.Marshal(jobResponseSuccess)
+		response, _ := json.Marshal(jobResponse{Success: true, Jobs: ids})
 		c.SetStatusCode(200)
 		c.SetContentType("application/json")
 		c.SetBody(response)
@@ -153,7 +201,76 @@ func (ws *WebServer) handlePostHttp(c *routing.Context) error {
 	return nil
 }
 
-func unmarshalHttpJobData(iter *jsoniter.Iterator) (*job.HttpData, error) {
+// submitHttpJob charges key's rate limit (if any), assigns a job ID,
+// registers its tracking record and hands the job off to the pool. The
+// limit is charged once per job rather than once per HTTP request, since
+// a single request can carry an array or an NDJSON stream of many jobs.
+func (ws *WebServer) submitHttpJob(jobData *job.HttpData, key *auth.Key) error {
+	if key != nil && !key.Allow() {
+		return ErrRateLimited
+	}
+	jobData.ID = job.NewID()
+	ws.pool.Jobs().Put(&job.Record{
+		ID:          jobData.ID,
+		State:       job.StateQueued,
+		SubmittedAt: time.Now(),
+	})
+	if err := ws.pool.AddJob("http", jobData); err != nil {
+		return err
+	}
+	return nil
+}
+
+// submitErrorStatus maps a submitHttpJob error to the HTTP status code it
+// should be reported as.
+func submitErrorStatus(err error) int {
+	if errors.Is(err, ErrRateLimited) {
+		return 429
+	}
+	return 503
+}
+
+// unmarshalErrorStatus maps an unmarshalHttpJobData error to the HTTP
+// status code it should be reported as.
+func unmarshalErrorStatus(err error) int {
+	if errors.Is(err, ErrURLNotAllowed) {
+		return 403
+	}
+	return 400
+}
+
+func (ws *WebServer) handleGetJob(c *routing.Context) error {
+	id := c.Param("id")
+	snap, ok := ws.pool.Jobs().Get(id)
+	if !ok {
+		return nilError(c, 404, "unknown job id")
+	}
+	body, _ := json.Marshal(snap)
+	c.SetStatusCode(200)
+	c.SetContentType("application/json")
+	c.SetBody(body)
+	return nil
+}
+
+func (ws *WebServer) handleListJobs(c *routing.Context) error {
+	state := job.State(c.QueryArgs().Peek("state"))
+	limit := 0
+	if raw := c.QueryArgs().Peek("limit"); len(raw) > 0 {
+		if n, err := strconv.Atoi(string(raw)); err == nil {
+			limit = n
+		}
+	}
+	body, _ := json.Marshal(jobsListResponse{
+		Success: true,
+		Jobs:    ws.pool.Jobs().List(state, limit),
+	})
+	c.SetStatusCode(200)
+	c.SetContentType("application/json")
+	c.SetBody(body)
+	return nil
+}
+
+func unmarshalHttpJobData(iter *jsoniter.Iterator, key *auth.Key) (*job.HttpData, error) {
 	jobData := job.AcquireHttpData()
 	for field := iter.ReadObject(); field != ""; field = iter.ReadObject() {
 		switch field {
@@ -165,6 +282,7 @@ func unmarshalHttpJobData(iter *jsoniter.Iterator) (*job.HttpData, error) {
 			rawBody, err := base64.StdEncoding.DecodeString(iter.ReadString())
 			if err != nil {
 				job.ReleaseHttpData(jobData)
+				drainObject(iter)
 				return nil, errors.New("invalid request, body must be base64 encoded")
 			}
 			jobData.RawBody = rawBody
@@ -178,18 +296,103 @@ func unmarshalHttpJobData(iter *jsoniter.Iterator) (*job.HttpData, error) {
 			for name := iter.ReadObject(); name != ""; name = iter.ReadObject() {
 				jobData.Headers[name] = iter.ReadString()
 			}
+		case "retry":
+			jobData.Retry = unmarshalRetryPolicy(iter)
+		case "callback":
+			jobData.Callback = unmarshalCallbackConfig(iter)
+		case "timeoutMs":
+			jobData.TimeoutMs = iter.ReadInt()
+		case "deadline":
+			raw := iter.ReadString()
+			deadline, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				job.ReleaseHttpData(jobData)
+				drainObject(iter)
+				return nil, errors.New("invalid request, deadline must be RFC3339")
+			}
+			jobData.Deadline = deadline
 		}
 	}
 	if jobData.Url == "" {
 		job.ReleaseHttpData(jobData)
 		return nil, errors.New("invalid request, url is not set")
 	}
+	if key != nil && !key.AllowsURL(jobData.Url) {
+		job.ReleaseHttpData(jobData)
+		return nil, fmt.Errorf("%w: url is not allowed for this api key", ErrURLNotAllowed)
+	}
+	if key != nil && jobData.Callback != nil && !key.AllowsURL(jobData.Callback.Url) {
+		job.ReleaseHttpData(jobData)
+		return nil, fmt.Errorf("%w: callback url is not allowed for this api key", ErrURLNotAllowed)
+	}
 	if jobData.Method == "" {
 		jobData.Method = "GET"
 	}
 	return jobData, nil
 }
 
+// drainObject consumes whatever is left of the JSON object iter is
+// currently positioned inside. Callers that bail out of
+// unmarshalHttpJobData partway through a row (a field-level parse error)
+// must call this before returning, so a shared streaming iterator (as
+// used by handleNdjsonBatch) is left at the object's closing brace
+// instead of somewhere inside it.
+func drainObject(iter *jsoniter.Iterator) {
+	for field := iter.ReadObject(); field != ""; field = iter.ReadObject() {
+		iter.Skip()
+	}
+}
+
+func unmarshalRetryPolicy(iter *jsoniter.Iterator) job.RetryPolicy {
+	var policy job.RetryPolicy
+	for field := iter.ReadObject(); field != ""; field = iter.ReadObject() {
+		switch field {
+		case "maxAttempts":
+			policy.MaxAttempts = iter.ReadInt()
+		case "initialDelayMs":
+			policy.InitialDelayMs = iter.ReadInt()
+		case "maxDelayMs":
+			policy.MaxDelayMs = iter.ReadInt()
+		case "multiplier":
+			policy.Multiplier = iter.ReadFloat64()
+		case "jitter":
+			policy.Jitter = iter.ReadFloat64()
+			policy.JitterSet = true
+		case "retryOn":
+			for iter.ReadArray() {
+				policy.RetryOn = append(policy.RetryOn, iter.ReadInt())
+			}
+		case "retryOnNetworkError":
+			policy.RetryOnNetworkError = iter.ReadBool()
+		default:
+			iter.Skip()
+		}
+	}
+	return policy.WithDefaults()
+}
+
+func unmarshalCallbackConfig(iter *jsoniter.Iterator) *job.CallbackConfig {
+	cfg := &job.CallbackConfig{IncludeBody: true}
+	for field := iter.ReadObject(); field != ""; field = iter.ReadObject() {
+		switch field {
+		case "url":
+			cfg.Url = iter.ReadString()
+		case "headers":
+			cfg.Headers = make(map[string]string)
+			for name := iter.ReadObject(); name != ""; name = iter.ReadObject() {
+				cfg.Headers[name] = iter.ReadString()
+			}
+		case "onlyOnFailure":
+			cfg.OnlyOnFailure = iter.ReadBool()
+		case "includeBody":
+			cfg.IncludeBody = iter.ReadBool()
+		default:
+			iter.Skip()
+		}
+	}
+	return cfg
+}
+
 func nilError(c *routing.Context, status int, body string) error {
 	c.Error(body, status)
 	return nil
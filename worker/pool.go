@@ -0,0 +1,396 @@
+package worker
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/xtrafrancyz/bwp/job"
+)
+
+var ErrQueueFull = errors.New("job queue is full")
+
+// ErrPoolClosed is returned by AddJob once Shutdown has been called.
+var ErrPoolClosed = errors.New("job pool is shutting down")
+
+// MaxRetryAttemptsCap is a global ceiling on job.RetryPolicy.MaxAttempts so
+// that a single misconfigured job can't monopolize a worker forever. It is
+// exposed as a var so it can be wired to a config flag.
+var MaxRetryAttemptsCap = 20
+
+// MaxCallbackBodyBytes caps how much of a job's response body is embedded,
+// base64-encoded, in its completion callback payload.
+var MaxCallbackBodyBytes = 65536
+
+// defaultClientTimeout hard-bounds a single client.Do/DoDeadline call.
+// fasthttp.Client has no context awareness of its own, so a job with
+// neither timeoutMs nor deadline set would otherwise be able to block its
+// worker on a hung remote server forever — including past Shutdown's
+// grace period. Per-job timeoutMs/deadline still apply on top of this via
+// DoDeadline and typically bind tighter; this is only the ceiling for
+// jobs that don't set either.
+var defaultClientTimeout = 2 * time.Minute
+
+// Handler processes a single dequeued job.
+type Handler func(data interface{})
+
+type queuedJob struct {
+	jobType string
+	data    interface{}
+}
+
+// Pool is a fixed-size pool of workers draining a bounded job queue. Jobs
+// are dispatched to a Handler registered for their type string; "http" and
+// "callback" are registered by default.
+type Pool struct {
+	Size      int
+	QueueSize int
+
+	client *fasthttp.Client
+	jobs   *job.Store
+	queue  chan queuedJob
+	active int32
+
+	handlersMu sync.RWMutex
+	handlers   map[string]Handler
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	closeMu sync.RWMutex
+	closing bool
+
+	wg sync.WaitGroup
+}
+
+func NewPool(size, queueSize int, jobs *job.Store) *Pool {
+	if jobs == nil {
+		jobs = job.NewStore(job.DefaultStoreConfig)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		Size:      size,
+		QueueSize: queueSize,
+		client:    &fasthttp.Client{ReadTimeout: defaultClientTimeout, WriteTimeout: defaultClientTimeout},
+		jobs:      jobs,
+		queue:     make(chan queuedJob, queueSize),
+		handlers:  make(map[string]Handler),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	_ = p.RegisterHandler("http", func(data interface{}) { p.runHttp(data.(*job.HttpData)) })
+	_ = p.RegisterHandler("callback", func(data interface{}) { p.runHttp(data.(*job.HttpData)) })
+	for i := 0; i < size; i++ {
+		p.wg.Add(1)
+		go p.worker()
+	}
+	return p
+}
+
+// RegisterHandler associates a job type with the function that executes
+// it. It returns an error if the type is already registered. Handlers
+// should be registered before jobs of that type are submitted.
+func (p *Pool) RegisterHandler(jobType string, handler Handler) error {
+	p.handlersMu.Lock()
+	defer p.handlersMu.Unlock()
+	if _, exists := p.handlers[jobType]; exists {
+		return fmt.Errorf("handler already registered for job type %q", jobType)
+	}
+	p.handlers[jobType] = handler
+	return nil
+}
+
+// Jobs returns the job.Store backing this pool's status tracking.
+func (p *Pool) Jobs() *job.Store {
+	return p.jobs
+}
+
+// Shutdown stops accepting new jobs and waits for in-flight ones to
+// finish. If ctx is done before that happens, it cancels every job's
+// context — aborting in-flight backoffs immediately and, bounded by the
+// client's own read/write timeout, in-flight HTTP attempts too — and
+// waits for workers to return, so Shutdown itself always returns once the
+// pool has actually drained.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.closeMu.Lock()
+	if p.closing {
+		p.closeMu.Unlock()
+		return nil
+	}
+	p.closing = true
+	close(p.queue)
+	p.closeMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// AddJob enqueues a job for processing, returning ErrQueueFull if the queue
+// is at capacity or ErrPoolClosed if Shutdown has been called.
+func (p *Pool) AddJob(jobType string, data interface{}) error {
+	p.closeMu.RLock()
+	defer p.closeMu.RUnlock()
+	if p.closing {
+		return ErrPoolClosed
+	}
+	select {
+	case p.queue <- queuedJob{jobType, data}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (p *Pool) GetQueueLength() int {
+	return len(p.queue)
+}
+
+func (p *Pool) GetActiveWorkers() int {
+	return int(atomic.LoadInt32(&p.active))
+}
+
+func (p *Pool) worker() {
+	defer p.wg.Done()
+	for qj := range p.queue {
+		atomic.AddInt32(&p.active, 1)
+		p.handlersMu.RLock()
+		handler, ok := p.handlers[qj.jobType]
+		p.handlersMu.RUnlock()
+		if !ok {
+			log.Printf("unknown job type %q", qj.jobType)
+		} else {
+			handler(qj.data)
+		}
+		atomic.AddInt32(&p.active, -1)
+	}
+}
+
+func (p *Pool) runHttp(data *job.HttpData) {
+	defer job.ReleaseHttpData(data)
+
+	rec := p.recordFor(data.ID)
+	started := time.Now()
+
+	ctx, cancel := data.Context(p.ctx)
+	defer cancel()
+
+	policy := data.Retry.WithDefaults()
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts > MaxRetryAttemptsCap {
+		maxAttempts = MaxRetryAttemptsCap
+	}
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.SetRequestURI(data.Url)
+	req.Header.SetMethod(data.Method)
+	for name, value := range data.Headers {
+		req.Header.Set(name, value)
+	}
+	if data.RawBody != nil {
+		req.SetBody(data.RawBody)
+	}
+
+	// finish marks the record, fires the completion callback and returns,
+	// classifying the outcome as a timeout whenever ctx ran out rather
+	// than a plain failure.
+	finish := func(attempt int, err error) {
+		state := job.StateFailed
+		if ctx.Err() == context.DeadlineExceeded {
+			state = job.StateTimeout
+		}
+		if rec != nil {
+			if state == job.StateTimeout {
+				rec.MarkTimeout(0, "", err)
+			} else {
+				rec.MarkFailed(0, "", err)
+			}
+		}
+		p.fireCallback(data, state, attempt, time.Since(started), resp, false, err)
+	}
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if rec != nil {
+			rec.MarkRunning()
+		}
+
+		resp.Reset()
+		var err error
+		if deadline, ok := ctx.Deadline(); ok {
+			err = p.client.DoDeadline(req, resp, deadline)
+		} else {
+			err = p.client.Do(req, resp)
+		}
+
+		statusCode := 0
+		if err == nil {
+			statusCode = resp.StatusCode()
+		} else {
+			log.Printf("job http %s %s attempt %d/%d failed: %s", data.Method, data.Url, attempt, maxAttempts, err)
+		}
+
+		// Retry while attempts remain and the outcome matches the policy.
+		// A context that ran out mid-backoff falls through to recording
+		// the terminal outcome below instead of retrying again.
+		if attempt < maxAttempts && policy.ShouldRetry(statusCode, err) {
+			if p.sleep(ctx, policy.Delay(attempt, signedJitter)) {
+				continue
+			}
+		}
+
+		if err == nil && policy.ShouldRetry(statusCode, nil) {
+			// Retries are exhausted (or the context ran out mid-backoff) on
+			// a status the caller configured as a failure: record it as
+			// failed rather than done, so onlyOnFailure callbacks still
+			// fire and Snapshot.State reflects the real outcome.
+			retryErr := fmt.Errorf("status %d did not succeed after %d attempt(s)", statusCode, attempt)
+			if rec != nil {
+				rec.MarkFailed(statusCode, snippet(resp.Body()), retryErr)
+			}
+			p.fireCallback(data, job.StateFailed, attempt, time.Since(started), resp, true, retryErr)
+			return
+		}
+
+		if err == nil {
+			if rec != nil {
+				rec.MarkDone(statusCode, snippet(resp.Body()))
+			}
+			p.fireCallback(data, job.StateDone, attempt, time.Since(started), resp, true, nil)
+		} else {
+			finish(attempt, err)
+		}
+		return
+	}
+}
+
+// fireCallback POSTs a completion notification for data's Callback config,
+// if any, by submitting it back through the pool as a "callback" job so it
+// shares the same worker pool and backpressure as ordinary jobs. The
+// callback job carries no retry block of its own, so DefaultRetryPolicy
+// applies and a failed callback delivery is attempted only once.
+// gotResponse reports whether resp actually holds a response received from
+// the remote server — true whenever the transport call itself succeeded,
+// even if the job's terminal state is failed (e.g. retries exhausted on a
+// bad status) rather than done.
+func (p *Pool) fireCallback(data *job.HttpData, state job.State, attempts int, duration time.Duration, resp *fasthttp.Response, gotResponse bool, jobErr error) {
+	cfg := data.Callback
+	if cfg == nil || cfg.Url == "" {
+		return
+	}
+	if cfg.OnlyOnFailure && state != job.StateFailed && state != job.StateTimeout {
+		return
+	}
+
+	payload := job.CallbackPayload{
+		JobID:      data.ID,
+		State:      state,
+		Attempts:   attempts,
+		DurationMs: duration.Milliseconds(),
+	}
+	if gotResponse {
+		payload.StatusCode = resp.StatusCode()
+		if cfg.IncludeBody {
+			payload.ResponseHeaders = make(map[string]string)
+			resp.Header.VisitAll(func(key, value []byte) {
+				payload.ResponseHeaders[string(key)] = string(value)
+			})
+			body := resp.Body()
+			if len(body) > MaxCallbackBodyBytes {
+				body = body[:MaxCallbackBodyBytes]
+			}
+			payload.ResponseBodyB64 = base64.StdEncoding.EncodeToString(body)
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("job callback %s: failed to encode payload: %s", data.ID, err)
+		return
+	}
+
+	callbackJob := job.AcquireHttpData()
+	callbackJob.Url = cfg.Url
+	callbackJob.Method = "POST"
+	callbackJob.RawBody = body
+	callbackJob.Headers = make(map[string]string, len(cfg.Headers)+1)
+	for name, value := range cfg.Headers {
+		callbackJob.Headers[name] = value
+	}
+	callbackJob.Headers["Content-Type"] = "application/json"
+
+	if err := p.AddJob("callback", callbackJob); err != nil {
+		log.Printf("job callback %s: failed to queue: %s", data.ID, err)
+		job.ReleaseHttpData(callbackJob)
+	}
+}
+
+// sleep waits for d, returning early (and false) if ctx is done first —
+// either because the job's own deadline elapsed or the pool is shutting
+// down.
+func (p *Pool) sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		select {
+		case <-ctx.Done():
+			return false
+		default:
+			return true
+		}
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// recordFor looks up the live *job.Record registered for an ID, if any.
+func (p *Pool) recordFor(id string) *job.Record {
+	if id == "" {
+		return nil
+	}
+	rec, _ := p.jobs.GetLive(id)
+	return rec
+}
+
+// signedJitter returns a random value in [-1, 1), matching what
+// job.RetryPolicy.Delay expects for its jitter fraction.
+func signedJitter() float64 {
+	return rand.Float64()*2 - 1
+}
+
+const maxResponseSnippet = 256
+
+func snippet(body []byte) string {
+	if len(body) > maxResponseSnippet {
+		body = body[:maxResponseSnippet]
+	}
+	return string(body)
+}